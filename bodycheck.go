@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Failure reasons surfaced on WebhookPayload/Event so on-call engineers can
+// see why a check failed without opening a browser.
+const (
+	reasonStatusMismatch = "status_mismatch"
+	reasonMissingKeyword = "missing_keyword"
+	reasonBadwordPresent = "badword_present"
+	reasonConnectError   = "connect_error"
+)
+
+const defaultMaxBodyBytes = 1 << 20 // 1 MiB
+
+// checkBody validates the response body of a check that already passed the
+// status code comparison. It reads at most application.MaxBodyBytes (or
+// defaultMaxBodyBytes) via io.LimitReader so a huge page can't OOM the
+// monitor, then confirms every Keyword is present and no Badword is present.
+// An empty reason means the body passed validation.
+func (m *Monitor) checkBody(application ApplicationConfig, resp *http.Response) (reason, token string, err error) {
+	if len(application.Keywords) == 0 && len(application.Badwords) == 0 {
+		io.Copy(io.Discard, resp.Body) // drain so the connection can be reused
+		return "", "", nil
+	}
+
+	limit := application.MaxBodyBytes
+	if limit <= 0 {
+		limit = defaultMaxBodyBytes
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	if err != nil {
+		return "", "", err
+	}
+	io.Copy(io.Discard, resp.Body) // drain any remainder beyond the limit
+
+	text := string(body)
+
+	for _, bad := range application.Badwords {
+		if strings.Contains(text, bad) {
+			return reasonBadwordPresent, bad, nil
+		}
+	}
+
+	for _, keyword := range application.Keywords {
+		if !strings.Contains(text, keyword) {
+			return reasonMissingKeyword, keyword, nil
+		}
+	}
+
+	return "", "", nil
+}
@@ -1,19 +1,17 @@
 package main
 
 import (
-	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"net/smtp"
 	"os"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/mattraydub/app-monitor/subscriptions"
 )
 
 // Config structures
@@ -22,21 +20,21 @@ type ApplicationConfig struct {
 	URL          string `json:"url"`
 	Enabled      bool   `json:"enabled"`
 	ExpectedCode int    `json:"expected_code"`
-}
 
-type EmailConfig struct {
-	SMTPHost  string `json:"smtp_host"`
-	SMTPPort  string `json:"smtp_port"`
-	Username  string `json:"username"`
-	Password  string `json:"password"`
-	FromEmail string `json:"from_email"`
-	ToEmail   string `json:"to_email"`
-}
+	// RecoverScript, when set, is run whenever the app is confirmed down; see recover.go.
+	RecoverScript      string `json:"recover_script,omitempty"`
+	RecoverMaxAttempts int    `json:"recover_max_attempts,omitempty"`
+	RecoverMaxDelay    string `json:"recover_max_delay,omitempty"`
 
-type WebhookConfig struct {
-	Enabled bool   `json:"enabled"`
-	URL     string `json:"url"`
-	Secret  string `json:"secret,omitempty"`
+	// Webhooks names entries in Config.Webhooks that should fire for this app; see webhook.go.
+	Webhooks []string `json:"webhooks,omitempty"`
+
+	// Keywords must all be present, and Badwords must all be absent, in the
+	// response body for a check to pass; see checkBody. MaxBodyBytes bounds
+	// how much of the body is read (default 1 MiB).
+	Keywords     []string `json:"keywords,omitempty"`
+	Badwords     []string `json:"badwords,omitempty"`
+	MaxBodyBytes int64    `json:"max_body_bytes,omitempty"`
 }
 
 type WebhookPayload struct {
@@ -48,20 +46,54 @@ type WebhookPayload struct {
 	ExpectedCode int    `json:"expected_code"`
 	Error        string `json:"error,omitempty"`
 	FailureCount int    `json:"failure_count"`
+	Reason       string `json:"reason,omitempty"`
+	Token        string `json:"token,omitempty"`
 }
 
 type Config struct {
 	CheckInterval string              `json:"check_interval"`
 	Applications  []ApplicationConfig `json:"applications"`
-	Email         EmailConfig         `json:"email"`
-	Webhook       WebhookConfig       `json:"webhook"`
+	Notifiers     []string            `json:"notifiers"`
+	Webhooks      []WebhookDef        `json:"webhooks"`
+
+	// SubscriptionsAddr, when set, serves the dynamic subscriptions control
+	// plane (see subscriptions package) on that address, e.g. ":9090".
+	SubscriptionsAddr string `json:"subscriptions_addr,omitempty"`
+	// SubscriptionsFile is where registered subscriptions are persisted.
+	SubscriptionsFile string `json:"subscriptions_file,omitempty"`
 }
 
 type Monitor struct {
-	config       Config
-	httpClient   *http.Client
-	alertTracker map[string]int // Changed from bool to int to track failure count
-	mu           sync.RWMutex
+	config     Config
+	httpClient *http.Client
+	dispatcher *Dispatcher
+	trackers   map[string]*appTracker
+	mu         sync.RWMutex
+}
+
+// notify fans an event out through both notification mechanisms: the
+// shoutrrr-backed Dispatcher and any named webhooks the application opted
+// into.
+func (m *Monitor) notify(application ApplicationConfig, event Event) {
+	if err := m.dispatcher.Dispatch(event); err != nil {
+		log.Printf("Failed to notify one or more targets for %s (%s): %v", application.Name, event.Type, err)
+	}
+	m.sendWebhooks(application.Webhooks, event)
+}
+
+// filterOutNames returns names with every entry in drop removed, preserving
+// order.
+func filterOutNames(names []string, drop map[string]bool) []string {
+	if len(drop) == 0 {
+		return names
+	}
+	kept := make([]string, 0, len(names))
+	for _, name := range names {
+		if !drop[name] {
+			kept = append(kept, name)
+		}
+	}
+	return kept
 }
 
 func loadConfig(filename string) (*Config, error) {
@@ -80,181 +112,69 @@ func loadConfig(filename string) (*Config, error) {
 	return &config, nil
 }
 
-func (m *Monitor) sendAlert(application ApplicationConfig, statusCode int, err error) {
+// sendAlert records a failed check and, once the app has failed
+// alertThreshold times in a row, transitions it to Down and fires an
+// application_down event. It returns true if that transition just happened,
+// so the caller knows whether to kick off recovery.
+func (m *Monitor) sendAlert(application ApplicationConfig, statusCode int, err error, reason, token string) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Increment the failure counter
-	m.alertTracker[application.Name]++
-
-	// Only send alert if we've failed twice and haven't already alerted
-	if m.alertTracker[application.Name] == 2 {
-		subject := fmt.Sprintf("ALERT: %s is DOWN", application.Name)
-		var body string
-
-		if err != nil {
-			body = fmt.Sprintf(`
-Service Alert - %s
-
-Application: %s
-URL: %s
-Status: Connection Failed
-Error: %s
-Time: %s
-Failed Attempts: 2
-
-Please investigate immediately.
-`, application.Name, application.Name, application.URL, err.Error(), time.Now().Format("2006-01-02 15:04:05"))
-		} else {
-			body = fmt.Sprintf(`
-Service Alert - %s
-
-Application: %s
-URL: %s
-Expected Status: %d
-Actual Status: %d
-Time: %s
-Failed Attempts: 2
-
-Please investigate immediately.
-`, application.Name, application.Name, application.URL, application.ExpectedCode, statusCode, time.Now().Format("2006-01-02 15:04:05"))
-		}
+	t := m.trackerFor(application.Name)
+	t.failures++
 
-		if err := m.sendEmail(subject, body); err != nil {
-			log.Printf("Failed to send email alert for %s: %v", application.Name, err)
-		} else {
-			log.Printf("Email alert sent for %s after 2 failures", application.Name)
+	if t.failures < alertThreshold || t.state == StateDown || t.state == StateRecovering || t.state == StateUnrecoverable {
+		if t.failures < alertThreshold {
+			t.state = StateHiccup
 		}
+		return false
+	}
 
-		webhookPayload := WebhookPayload{
-			Event:        "application_down",
-			Application:  application.Name,
-			URL:          application.URL,
-			Timestamp:    time.Now().Unix(),
-			StatusCode:   statusCode,
-			ExpectedCode: application.ExpectedCode,
-			FailureCount: 2,
-		}
+	t.state = StateDown
 
-		if err != nil {
-			webhookPayload.Error = err.Error()
-		}
+	event := Event{
+		Type:         "application_down",
+		Application:  application.Name,
+		URL:          application.URL,
+		Timestamp:    time.Now(),
+		StatusCode:   statusCode,
+		ExpectedCode: application.ExpectedCode,
+		Err:          err,
+		FailureCount: t.failures,
+		Reason:       reason,
+		Token:        token,
+	}
 
-		if webhookErr := m.sendWebhook(webhookPayload); webhookErr != nil {
-			log.Printf("Failed to send webhook alert for %s: %v", application.Name, webhookErr)
-		} else if m.config.Webhook.Enabled {
-			log.Printf("Webhook alert sent for %s after 2 failures", application.Name)
-		}
+	m.notify(application, event)
+	log.Printf("Alert notifications sent for %s after %d failures", application.Name, t.failures)
 
-		m.alertTracker[application.Name] = 3 // Use 3 to indicate alert was sent
-	}
+	return true
 }
 
 func (m *Monitor) sendRecoveryNotice(application ApplicationConfig) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
 
-	// Only send recovery notice if we previously sent an alert (count >= 3)
-	if m.alertTracker[application.Name] < 3 {
-		m.alertTracker[application.Name] = 0 // Reset counter on recovery
-		return
-	}
-
-	subject := fmt.Sprintf("RECOVERY: %s is back online", application.Name)
-	body := fmt.Sprintf(`
-Service Recovery - %s
-
-Application: %s
-URL: %s
-Status: OK
-Time: %s
+	t := m.trackerFor(application.Name)
+	wasDown := t.state == StateDown || t.state == StateRecovering || t.state == StateUnrecoverable
+	t.state = StateUp
+	t.failures = 0
+	m.mu.Unlock()
 
-Service has recovered and is responding normally.
-`, application.Name, application.Name, application.URL, time.Now().Format("2006-01-02 15:04:05"))
-
-	if err := m.sendEmail(subject, body); err != nil {
-		log.Printf("Failed to send recovery email for %s: %v", application.Name, err)
-	} else {
-		log.Printf("Recovery email sent for %s", application.Name)
+	if !wasDown {
+		return
 	}
 
-	webhookPayload := WebhookPayload{
-		Event:        "application_recovery",
+	event := Event{
+		Type:         "application_recovery",
 		Application:  application.Name,
 		URL:          application.URL,
-		Timestamp:    time.Now().Unix(),
+		Timestamp:    time.Now(),
 		StatusCode:   200, // Assuming recovery means successful status
 		ExpectedCode: application.ExpectedCode,
-		FailureCount: 0,
-	}
-
-	if webhookErr := m.sendWebhook(webhookPayload); webhookErr != nil {
-		log.Printf("Failed to send webhook recovery notice for %s: %v", application.Name, webhookErr)
-	} else if m.config.Webhook.Enabled {
-		log.Printf("Webhook recovery notice sent for %s", application.Name)
 	}
 
-	m.alertTracker[application.Name] = 0 // Reset counter on recovery
-}
-
-func (m *Monitor) sendEmail(subject, body string) error {
-	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s",
-		m.config.Email.FromEmail,
-		m.config.Email.ToEmail,
-		subject,
-		body)
-
-	auth := smtp.PlainAuth("",
-		m.config.Email.Username,
-		m.config.Email.Password,
-		m.config.Email.SMTPHost)
-
-	addr := fmt.Sprintf("%s:%s", m.config.Email.SMTPHost, m.config.Email.SMTPPort)
-
-	return smtp.SendMail(addr, auth, m.config.Email.FromEmail,
-		[]string{m.config.Email.ToEmail}, []byte(msg))
-}
-
-func (m *Monitor) generateWebhookSignature(payload []byte, secret string) string {
-	h := hmac.New(sha256.New, []byte(secret))
-	h.Write(payload)
-	return "sha256=" + hex.EncodeToString(h.Sum(nil))
-}
-
-func (m *Monitor) sendWebhook(payload WebhookPayload) error {
-	if !m.config.Webhook.Enabled || m.config.Webhook.URL == "" {
-		return nil
-	}
-
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal webhook payload: %w", err)
-	}
-
-	req, err := http.NewRequest("POST", m.config.Webhook.URL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create webhook request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", "AppMonitor/1.0")
-
-	if m.config.Webhook.Secret != "" {
-		signature := m.generateWebhookSignature(jsonData, m.config.Webhook.Secret)
-		req.Header.Set("X-AppMonitor-Signature", signature)
-	}
-
-	resp, err := m.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send webhook: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("webhook request failed with status %d", resp.StatusCode)
-	}
-
-	return nil
+	m.notify(application, event)
+	log.Printf("Recovery notifications sent for %s", application.Name)
 }
 
 func (m *Monitor) checkApplication(application ApplicationConfig) {
@@ -265,24 +185,44 @@ func (m *Monitor) checkApplication(application ApplicationConfig) {
 	resp, err := m.httpClient.Get(application.URL)
 	if err != nil {
 		log.Printf("ERROR: Failed to connect to %s (%s): %v", application.Name, application.URL, err)
-		m.sendAlert(application, 0, err)
+		if m.sendAlert(application, 0, err, reasonConnectError, "") && application.RecoverScript != "" {
+			go m.recover(application)
+		}
 		return
 	}
 	defer resp.Body.Close()
 
-	// Read and discard response body to allow connection reuse
-	io.Copy(io.Discard, resp.Body)
-
 	timestamp := time.Now().Format("2006-01-02 15:04:05")
 
-	if resp.StatusCode == application.ExpectedCode {
-		fmt.Printf("[%s] OK - %s is healthy (Status: %d)\n", timestamp, application.Name, resp.StatusCode)
-		m.sendRecoveryNotice(application)
-	} else {
+	if resp.StatusCode != application.ExpectedCode {
+		io.Copy(io.Discard, resp.Body) // drain so the connection can be reused
 		log.Printf("[%s] WARNING - %s returned unexpected status code: %d (expected: %d)",
 			timestamp, application.Name, resp.StatusCode, application.ExpectedCode)
-		m.sendAlert(application, resp.StatusCode, nil)
+		if m.sendAlert(application, resp.StatusCode, nil, reasonStatusMismatch, "") && application.RecoverScript != "" {
+			go m.recover(application)
+		}
+		return
+	}
+
+	reason, token, err := m.checkBody(application, resp)
+	if err != nil {
+		log.Printf("[%s] WARNING - failed to read response body for %s: %v", timestamp, application.Name, err)
+		if m.sendAlert(application, resp.StatusCode, err, reasonConnectError, "") && application.RecoverScript != "" {
+			go m.recover(application)
+		}
+		return
+	}
+
+	if reason != "" {
+		log.Printf("[%s] WARNING - %s failed body validation: %s (%q)", timestamp, application.Name, reason, token)
+		if m.sendAlert(application, resp.StatusCode, nil, reason, token) && application.RecoverScript != "" {
+			go m.recover(application)
+		}
+		return
 	}
+
+	fmt.Printf("[%s] OK - %s is healthy (Status: %d)\n", timestamp, application.Name, resp.StatusCode)
+	m.sendRecoveryNotice(application)
 }
 
 func (m *Monitor) runChecks() {
@@ -315,12 +255,83 @@ func main() {
 		log.Fatalf("Invalid check interval: %v", err)
 	}
 
+	subscriptionsFile := config.SubscriptionsFile
+	if subscriptionsFile == "" {
+		subscriptionsFile = "subscriptions.json"
+	}
+	subsManager, err := subscriptions.NewManager(subscriptions.NewFileStore(subscriptionsFile), &http.Client{Timeout: 10 * time.Second})
+	if err != nil {
+		log.Fatalf("Failed to set up subscriptions: %v", err)
+	}
+
+	// Fold the statically configured webhooks into the subscription store so
+	// existing users keep working after adopting the dynamic control plane.
+	// Only webhooks with nothing beyond a URL/secret are eligible: the
+	// subscription delivers the generic JSON event, so one with Basic auth,
+	// custom headers, a form body, or a custom JSON body would otherwise get
+	// malformed requests (and likely get banned after enough retries).
+	// Eligible webhooks are migrated as subscriptions scoped to the
+	// applications that reference them, and dropped from each app's
+	// Webhooks list so they aren't also delivered (duplicated) through the
+	// templated per-app path.
+	webhookApps := make(map[string][]string) // webhook name -> app names that reference it
+	for _, app := range config.Applications {
+		for _, name := range app.Webhooks {
+			webhookApps[name] = append(webhookApps[name], app.Name)
+		}
+	}
+
+	migrated := make(map[string]bool) // webhook names migrated into subscriptions
+	var migrationTargets []subscriptions.MigrationTarget
+	for name, apps := range webhookApps {
+		def, ok := findWebhookDef(config.Webhooks, name)
+		if !ok {
+			continue
+		}
+		if strings.Contains(def.URL, "{{") {
+			log.Printf("Not migrating webhook %q into subscriptions store: URL is templated", def.Name)
+			continue
+		}
+		if def.Auth != nil || len(def.Headers) > 0 || def.Mode == "form" || len(def.Form) > 0 || def.Body != "" {
+			log.Printf("Not migrating webhook %q into subscriptions store: uses auth/headers/a custom body not supported by the generic subscription payload", def.Name)
+			continue
+		}
+
+		migrationTargets = append(migrationTargets, subscriptions.MigrationTarget{URL: def.URL, Secret: def.Secret, Applications: apps})
+		migrated[name] = true
+	}
+	if err := subsManager.Migrate(migrationTargets); err != nil {
+		log.Fatalf("Failed to migrate webhooks into subscriptions store: %v", err)
+	}
+
+	for i, app := range config.Applications {
+		config.Applications[i].Webhooks = filterOutNames(app.Webhooks, migrated)
+	}
+
+	dispatcher, err := NewDispatcher(config.Notifiers, &subscriptionsNotifier{manager: subsManager})
+	if err != nil {
+		log.Fatalf("Failed to set up notifiers: %v", err)
+	}
+
+	if config.SubscriptionsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/subscriptions", subsManager)
+		mux.Handle("/subscriptions/", subsManager)
+		go func() {
+			log.Printf("Subscriptions control plane listening on %s", config.SubscriptionsAddr)
+			if err := http.ListenAndServe(config.SubscriptionsAddr, mux); err != nil {
+				log.Fatalf("Subscriptions control plane failed: %v", err)
+			}
+		}()
+	}
+
 	monitor := &Monitor{
 		config: *config,
 		httpClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
-		alertTracker: make(map[string]int), // Changed from bool to int
+		dispatcher: dispatcher,
+		trackers:   make(map[string]*appTracker),
 	}
 
 	// Count enabled applications
@@ -333,12 +344,7 @@ func main() {
 
 	fmt.Printf("Starting App monitor with %d enabled applications\n", enabledCount)
 	fmt.Printf("Check interval: %v\n", checkInterval)
-	fmt.Printf("Alert email: %s\n", config.Email.ToEmail)
-	if config.Webhook.Enabled {
-		fmt.Printf("Webhook notifications: enabled (%s)\n", config.Webhook.URL)
-	} else {
-		fmt.Println("Webhook notifications: disabled")
-	}
+	fmt.Printf("Notifiers configured: %d\n", len(config.Notifiers))
 	fmt.Println("Press Ctrl+C to stop")
 
 	// Initial check
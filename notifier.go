@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containrrr/shoutrrr"
+	"github.com/containrrr/shoutrrr/pkg/router"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/mattraydub/app-monitor/subscriptions"
+)
+
+// Event describes a single health-check outcome that should be fanned out
+// to every configured notifier.
+type Event struct {
+	Type         string // "application_down", "application_recovery", ...
+	Application  string
+	URL          string
+	Timestamp    time.Time
+	StatusCode   int
+	ExpectedCode int
+	Err          error
+	FailureCount int    // consecutive failures so far; 0 once the app is up
+	Reason       string // one of the reason* constants in bodycheck.go, when applicable
+	Token        string // the keyword/badword that triggered Reason, if any
+}
+
+func (e Event) subject() string {
+	switch e.Type {
+	case "application_recovery":
+		return fmt.Sprintf("RECOVERY: %s is back online", e.Application)
+	case "recovery_attempted":
+		return fmt.Sprintf("RECOVERING: %s - running recover script", e.Application)
+	case "recovery_succeeded":
+		return fmt.Sprintf("RECOVERED: %s was brought back by its recover script", e.Application)
+	case "unrecoverable":
+		return fmt.Sprintf("UNRECOVERABLE: %s is still down after recovery attempts", e.Application)
+	default:
+		return fmt.Sprintf("ALERT: %s is DOWN", e.Application)
+	}
+}
+
+func (e Event) body() string {
+	switch e.Type {
+	case "recovery_attempted", "recovery_succeeded", "unrecoverable":
+		return fmt.Sprintf("Application: %s\nURL: %s\nTime: %s",
+			e.Application, e.URL, e.Timestamp.Format("2006-01-02 15:04:05"))
+	}
+
+	if e.Err != nil {
+		return fmt.Sprintf("Application: %s\nURL: %s\nStatus: Connection Failed\nError: %s\nTime: %s",
+			e.Application, e.URL, e.Err.Error(), e.Timestamp.Format("2006-01-02 15:04:05"))
+	}
+
+	reason := ""
+	switch e.Reason {
+	case reasonMissingKeyword:
+		reason = fmt.Sprintf("\nReason: missing required keyword %q", e.Token)
+	case reasonBadwordPresent:
+		reason = fmt.Sprintf("\nReason: badword %q present in response", e.Token)
+	}
+
+	return fmt.Sprintf("Application: %s\nURL: %s\nExpected Status: %d\nActual Status: %d\nTime: %s%s",
+		e.Application, e.URL, e.ExpectedCode, e.StatusCode, e.Timestamp.Format("2006-01-02 15:04:05"), reason)
+}
+
+func (e Event) payload() WebhookPayload {
+	p := WebhookPayload{
+		Event:        e.Type,
+		Application:  e.Application,
+		URL:          e.URL,
+		Timestamp:    e.Timestamp.Unix(),
+		StatusCode:   e.StatusCode,
+		ExpectedCode: e.ExpectedCode,
+		FailureCount: e.FailureCount,
+		Reason:       e.Reason,
+		Token:        e.Token,
+	}
+	if e.Err != nil {
+		p.Error = e.Err.Error()
+	}
+	return p
+}
+
+// Notifier delivers a single notification to one destination.
+type Notifier interface {
+	Send(subject, body string, payload WebhookPayload) error
+}
+
+// Dispatcher fans an Event out to every configured Notifier concurrently,
+// collecting per-target failures into a single error.
+type Dispatcher struct {
+	notifiers []Notifier
+}
+
+// NewDispatcher builds a Dispatcher from the notifier URLs in the config,
+// plus any extra notifiers the caller wants fanned out to (e.g. the
+// subscriptions.Manager control plane).
+// Every scheme shoutrrr understands (discord://, telegram://, pushover://,
+// slack://, smtp://, teams://, ...) is supported, plus the app-monitor
+// specific script:// scheme for running a local command.
+func NewDispatcher(urls []string, extra ...Notifier) (*Dispatcher, error) {
+	d := &Dispatcher{}
+	for _, u := range urls {
+		n, err := newNotifier(u)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %q: %w", u, err)
+		}
+		d.notifiers = append(d.notifiers, n)
+	}
+	d.notifiers = append(d.notifiers, extra...)
+	return d, nil
+}
+
+func newNotifier(url string) (Notifier, error) {
+	if strings.HasPrefix(url, "script://") {
+		return &scriptNotifier{path: strings.TrimPrefix(url, "script://")}, nil
+	}
+
+	sender, err := shoutrrr.CreateSender(url)
+	if err != nil {
+		return nil, err
+	}
+	return &shoutrrrNotifier{sender: sender}, nil
+}
+
+// Dispatch sends the event to every notifier concurrently and returns a
+// combined error describing any targets that failed.
+func (d *Dispatcher) Dispatch(event Event) error {
+	subject := event.subject()
+	body := event.body()
+	payload := event.payload()
+
+	var (
+		g       errgroup.Group
+		mu      sync.Mutex
+		allErrs []error
+	)
+	for _, n := range d.notifiers {
+		n := n
+		g.Go(func() error {
+			if err := n.Send(subject, body, payload); err != nil {
+				mu.Lock()
+				allErrs = append(allErrs, err)
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	g.Wait()
+	return errors.Join(allErrs...)
+}
+
+// shoutrrrNotifier delivers a notification through one of shoutrrr's
+// supported URL schemes (discord, telegram, pushover, slack, smtp, teams, ...).
+type shoutrrrNotifier struct {
+	sender *router.ServiceRouter
+}
+
+func (n *shoutrrrNotifier) Send(subject, body string, payload WebhookPayload) error {
+	message := body
+	if subject != "" {
+		message = subject + "\n\n" + body
+	}
+	if errs := n.sender.Send(message, nil); len(errs) > 0 {
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// scriptNotifier execs a local script for each event, passing the event
+// fields both as environment variables and as JSON on stdin so operators
+// can wire arbitrary actions (paging, runbooks, custom integrations).
+type scriptNotifier struct {
+	path string
+}
+
+func (n *scriptNotifier) Send(subject, body string, payload WebhookPayload) error {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event payload: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, n.path)
+	cmd.Stdin = bytes.NewReader(payloadJSON)
+	cmd.Env = append(cmd.Environ(),
+		"APPMONITOR_EVENT="+payload.Event,
+		"APPMONITOR_APPLICATION="+payload.Application,
+		"APPMONITOR_URL="+payload.URL,
+		"APPMONITOR_SUBJECT="+subject,
+		"APPMONITOR_BODY="+body,
+		fmt.Sprintf("APPMONITOR_STATUS_CODE=%d", payload.StatusCode),
+		fmt.Sprintf("APPMONITOR_EXPECTED_CODE=%d", payload.ExpectedCode),
+	)
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("script %s failed: %w (output: %s)", n.path, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// subscriptionsNotifier fans events into the subscriptions.Manager control
+// plane, so runtime-registered subscribers receive the same alert/recovery
+// events as the statically configured notifiers.
+type subscriptionsNotifier struct {
+	manager *subscriptions.Manager
+}
+
+func (n *subscriptionsNotifier) Send(_, _ string, payload WebhookPayload) error {
+	n.manager.Publish(subscriptions.Event{
+		Type:         payload.Event,
+		Application:  payload.Application,
+		URL:          payload.URL,
+		Timestamp:    payload.Timestamp,
+		StatusCode:   payload.StatusCode,
+		ExpectedCode: payload.ExpectedCode,
+		Error:        payload.Error,
+		Reason:       payload.Reason,
+		Token:        payload.Token,
+	})
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os/exec"
+	"time"
+)
+
+// AppState models the lifecycle of a single monitored application. A plain
+// failure counter can't distinguish "we just alerted" from "we're actively
+// running a recover script", so each app tracks one of these explicitly.
+type AppState int
+
+const (
+	StateUp AppState = iota
+	StateHiccup
+	StateDown
+	StateRecovering
+	StateUnrecoverable
+)
+
+func (s AppState) String() string {
+	switch s {
+	case StateUp:
+		return "up"
+	case StateHiccup:
+		return "hiccup"
+	case StateDown:
+		return "down"
+	case StateRecovering:
+		return "recovering"
+	case StateUnrecoverable:
+		return "unrecoverable"
+	default:
+		return "unknown"
+	}
+}
+
+// appTracker holds the per-application state used to decide when to alert
+// and when to kick off recovery.
+type appTracker struct {
+	state    AppState
+	failures int
+}
+
+const (
+	alertThreshold = 2 // consecutive failures before we consider the app down
+
+	initialRecoverDelay      = 10 * time.Second
+	defaultRecoverMaxDelay   = 5 * time.Minute
+	defaultRecoverMaxAttempt = 5
+)
+
+// trackerFor returns the tracker for an application, creating it on first
+// use. Callers must hold m.mu.
+func (m *Monitor) trackerFor(name string) *appTracker {
+	t, ok := m.trackers[name]
+	if !ok {
+		t = &appTracker{state: StateUp}
+		m.trackers[name] = t
+	}
+	return t
+}
+
+// currentFailures returns the application's current consecutive failure
+// count, for events raised outside sendAlert/sendRecoveryNotice.
+func (m *Monitor) currentFailures(name string) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if t, ok := m.trackers[name]; ok {
+		return t.failures
+	}
+	return 0
+}
+
+// recover shells out to the application's recover script and re-checks the
+// URL with exponential backoff until it comes back up or the attempt budget
+// is exhausted; a failing script run is logged and counts as an attempt.
+// Callers must run
+// it on its own goroutine (it sleeps across attempts for the whole recovery
+// window), so the check round it was triggered from isn't blocked and other
+// applications keep being checked on schedule.
+func (m *Monitor) recover(application ApplicationConfig) {
+	maxAttempts := application.RecoverMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultRecoverMaxAttempt
+	}
+
+	maxDelay := defaultRecoverMaxDelay
+	if application.RecoverMaxDelay != "" {
+		if d, err := time.ParseDuration(application.RecoverMaxDelay); err == nil {
+			maxDelay = d
+		} else {
+			log.Printf("Invalid recover_max_delay %q for %s, using default %v", application.RecoverMaxDelay, application.Name, defaultRecoverMaxDelay)
+		}
+	}
+
+	m.mu.Lock()
+	m.trackerFor(application.Name).state = StateRecovering
+	m.mu.Unlock()
+
+	delay := initialRecoverDelay
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		log.Printf("Running recover script for %s (attempt %d/%d): %s", application.Name, attempt, maxAttempts, application.RecoverScript)
+
+		m.notify(application, Event{
+			Type:         "recovery_attempted",
+			Application:  application.Name,
+			URL:          application.URL,
+			Timestamp:    time.Now(),
+			FailureCount: m.currentFailures(application.Name),
+		})
+
+		if err := m.runRecoverScript(application); err != nil {
+			log.Printf("Recover script for %s failed: %v", application.Name, err)
+		}
+
+		time.Sleep(delay)
+
+		if m.probe(application) {
+			log.Printf("Recover script brought %s back up after %d attempt(s)", application.Name, attempt)
+
+			m.mu.Lock()
+			t := m.trackerFor(application.Name)
+			t.state = StateUp
+			t.failures = 0
+			m.mu.Unlock()
+
+			m.notify(application, Event{
+				Type:        "recovery_succeeded",
+				Application: application.Name,
+				URL:         application.URL,
+				Timestamp:   time.Now(),
+			})
+			return
+		}
+
+		delay *= 2
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+
+	log.Printf("Giving up on %s after %d recover attempts", application.Name, maxAttempts)
+
+	m.mu.Lock()
+	m.trackerFor(application.Name).state = StateUnrecoverable
+	m.mu.Unlock()
+
+	m.notify(application, Event{
+		Type:         "unrecoverable",
+		Application:  application.Name,
+		URL:          application.URL,
+		Timestamp:    time.Now(),
+		FailureCount: m.currentFailures(application.Name),
+	})
+}
+
+func (m *Monitor) runRecoverScript(application ApplicationConfig) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, application.RecoverScript)
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		log.Printf("Recover script output for %s: %s", application.Name, out)
+	}
+	return err
+}
+
+// probe does a single health check without touching the alert tracker,
+// used by recover to decide whether the outage has cleared.
+func (m *Monitor) probe(application ApplicationConfig) bool {
+	resp, err := m.httpClient.Get(application.URL)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode == application.ExpectedCode
+}
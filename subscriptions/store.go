@@ -0,0 +1,67 @@
+package subscriptions
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Store persists the set of subscriptions so they survive restarts.
+// FileStore is the default; callers can supply their own implementation
+// (e.g. backed by a database) as long as it satisfies this interface.
+type Store interface {
+	Load() ([]*Subscription, error)
+	Save(subs []*Subscription) error
+}
+
+// FileStore persists subscriptions to a JSON file on disk.
+type FileStore struct {
+	path string
+
+	// mu serializes Save, since the Manager calls it from several goroutines
+	// (recordFailure, handleCreate, handleDelete, handleUnban) with no lock
+	// of its own held across the write+rename.
+	mu sync.Mutex
+}
+
+// NewFileStore returns a Store backed by the JSON file at path. The file is
+// created on first Save if it doesn't already exist.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+func (s *FileStore) Load() ([]*Subscription, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read subscriptions file: %w", err)
+	}
+
+	var subs []*Subscription
+	if err := json.Unmarshal(data, &subs); err != nil {
+		return nil, fmt.Errorf("failed to decode subscriptions file: %w", err)
+	}
+	return subs, nil
+}
+
+func (s *FileStore) Save(subs []*Subscription) error {
+	data, err := json.MarshalIndent(subs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode subscriptions: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write subscriptions file: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace subscriptions file: %w", err)
+	}
+	return nil
+}
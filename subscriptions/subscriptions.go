@@ -0,0 +1,436 @@
+// Package subscriptions implements a small HTTP control plane for
+// registering webhook receivers at runtime, instead of baking them into the
+// static config file. Registered subscriptions are persisted to a Store so
+// they survive restarts, and each one gets its own delivery worker with
+// retry and ban handling so one slow or dead receiver can't block the rest.
+package subscriptions
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	eventQueueSize  = 32
+	maxAttempts     = 5
+	initialDelay    = 1 * time.Second
+	maxDelay        = 30 * time.Second
+	banThreshold    = 5
+	deliveryTimeout = 10 * time.Second
+)
+
+// Event is the payload delivered to subscribers. It carries the same fields,
+// under the same JSON names, as app-monitor's own webhook/notifier payload,
+// except failure_count, which subscribers do not receive.
+type Event struct {
+	Type         string `json:"event"`
+	Application  string `json:"application"`
+	URL          string `json:"url"`
+	Timestamp    int64  `json:"timestamp"`
+	StatusCode   int    `json:"status_code"`
+	ExpectedCode int    `json:"expected_code"`
+	Error        string `json:"error,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+	Token        string `json:"token,omitempty"`
+}
+
+// Subscription is a single registered webhook receiver.
+type Subscription struct {
+	ID           string    `json:"id"`
+	URL          string    `json:"url"`
+	Secret       string    `json:"secret,omitempty"`
+	EventTypes   []string  `json:"event_types,omitempty"`  // empty means all event types
+	Applications []string  `json:"applications,omitempty"` // empty means all applications
+	Banned       bool      `json:"banned"`
+	Failures     int       `json:"failures"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (s *Subscription) wants(eventType, application string) bool {
+	if len(s.EventTypes) > 0 {
+		matched := false
+		for _, t := range s.EventTypes {
+			if t == eventType {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(s.Applications) > 0 {
+		matched := false
+		for _, a := range s.Applications {
+			if a == application {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+type worker struct {
+	sub *Subscription
+	ch  chan Event
+}
+
+// Manager owns the set of subscriptions, their delivery workers, and the
+// HTTP handlers used to manage them. It implements http.Handler so it can
+// be mounted directly on a ServeMux.
+type Manager struct {
+	store      Store
+	httpClient *http.Client
+
+	mu      sync.RWMutex
+	workers map[string]*worker
+}
+
+// NewManager loads persisted subscriptions from store and starts a delivery
+// worker for each one.
+func NewManager(store Store, httpClient *http.Client) (*Manager, error) {
+	m := &Manager{
+		store:      store,
+		httpClient: httpClient,
+		workers:    make(map[string]*worker),
+	}
+
+	subs, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	for _, sub := range subs {
+		m.startWorker(sub)
+	}
+	return m, nil
+}
+
+// Publish fans an event out to every subscription whose event filter
+// matches. Delivery happens asynchronously on each subscription's worker;
+// Publish never blocks on network I/O.
+func (m *Manager) Publish(event Event) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, w := range m.workers {
+		if w.sub.Banned || !w.sub.wants(event.Type, event.Application) {
+			continue
+		}
+		select {
+		case w.ch <- event:
+		default:
+			log.Printf("subscriptions: dropping event for %s, delivery queue full", w.sub.URL)
+		}
+	}
+}
+
+func (m *Manager) startWorker(sub *Subscription) {
+	w := &worker{sub: sub, ch: make(chan Event, eventQueueSize)}
+	m.workers[sub.ID] = w
+	go m.run(w)
+}
+
+func (m *Manager) run(w *worker) {
+	for event := range w.ch {
+		if err := m.deliverWithRetry(w.sub, event); err != nil {
+			log.Printf("subscriptions: giving up delivering to %s: %v", w.sub.URL, err)
+			m.recordFailure(w.sub)
+		} else {
+			m.recordSuccess(w.sub)
+		}
+	}
+}
+
+func (m *Manager) deliverWithRetry(sub *Subscription, event Event) error {
+	delay := initialDelay
+	var lastErr error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if err := m.deliver(sub, event); err != nil {
+			lastErr = err
+			log.Printf("subscriptions: delivery to %s failed (attempt %d/%d): %v", sub.URL, attempt, maxAttempts, err)
+			if attempt == maxAttempts {
+				break
+			}
+			time.Sleep(delay)
+			delay *= 2
+			if delay > maxDelay {
+				delay = maxDelay
+			}
+			continue
+		}
+		return nil
+	}
+	return lastErr
+}
+
+func (m *Manager) deliver(sub *Subscription, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "AppMonitor/1.0")
+
+	if sub.Secret != "" {
+		h := hmac.New(sha256.New, []byte(sub.Secret))
+		h.Write(body)
+		req.Header.Set("X-AppMonitor-Signature", "sha256="+hex.EncodeToString(h.Sum(nil)))
+	}
+
+	client := m.httpClient
+	if client == nil {
+		client = &http.Client{Timeout: deliveryTimeout}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("subscriber returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (m *Manager) recordSuccess(sub *Subscription) {
+	m.mu.Lock()
+	sub.Failures = 0
+	m.mu.Unlock()
+}
+
+func (m *Manager) recordFailure(sub *Subscription) {
+	m.mu.Lock()
+	sub.Failures++
+	if sub.Failures >= banThreshold {
+		sub.Banned = true
+		log.Printf("subscriptions: banning %s after %d consecutive failed deliveries", sub.URL, sub.Failures)
+	}
+	subs := m.snapshotLocked()
+	m.mu.Unlock()
+
+	if err := m.store.Save(subs); err != nil {
+		log.Printf("subscriptions: failed to persist ban state: %v", err)
+	}
+}
+
+// snapshotLocked returns copies of the current subscriptions, safe to read,
+// encode, or persist after releasing m.mu while workers keep mutating the
+// live subscriptions concurrently. Callers must hold m.mu.
+func (m *Manager) snapshotLocked() []*Subscription {
+	subs := make([]*Subscription, 0, len(m.workers))
+	for _, w := range m.workers {
+		copy := *w.sub
+		subs = append(subs, &copy)
+	}
+	return subs
+}
+
+func randomID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// MigrationTarget is a statically configured notification target to fold
+// into the subscription store at startup, so existing users keep working
+// after switching to the dynamic control plane. Applications scopes
+// delivery to the apps that referenced this target; leave it empty only
+// for a target that should receive every application's events.
+type MigrationTarget struct {
+	URL          string
+	Secret       string
+	Applications []string
+}
+
+func migrationKey(url string, applications []string) string {
+	return url + "|" + strings.Join(applications, ",")
+}
+
+// Migrate registers a subscription for each target not already present,
+// skipping duplicates (by URL + application scope) so repeated startups
+// don't pile up copies.
+func (m *Manager) Migrate(targets []MigrationTarget) error {
+	m.mu.Lock()
+	existing := make(map[string]bool, len(m.workers))
+	for _, w := range m.workers {
+		existing[migrationKey(w.sub.URL, w.sub.Applications)] = true
+	}
+
+	added := false
+	for _, target := range targets {
+		if target.URL == "" {
+			continue
+		}
+		key := migrationKey(target.URL, target.Applications)
+		if existing[key] {
+			continue
+		}
+		id, err := randomID()
+		if err != nil {
+			m.mu.Unlock()
+			return fmt.Errorf("failed to generate subscription id: %w", err)
+		}
+		sub := &Subscription{ID: id, URL: target.URL, Secret: target.Secret, Applications: target.Applications, CreatedAt: time.Now()}
+		m.startWorker(sub)
+		existing[key] = true
+		added = true
+	}
+	subs := m.snapshotLocked()
+	m.mu.Unlock()
+
+	if !added {
+		return nil
+	}
+	return m.store.Save(subs)
+}
+
+// ServeHTTP implements the control plane:
+//
+//	POST   /subscriptions            register a new subscription
+//	GET    /subscriptions            list subscriptions
+//	DELETE /subscriptions/{id}       remove a subscription
+//	POST   /subscriptions/{id}/unban clear ban state and resume delivery
+func (m *Manager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/subscriptions")
+
+	switch {
+	case path == "" || path == "/":
+		switch r.Method {
+		case http.MethodPost:
+			m.handleCreate(w, r)
+		case http.MethodGet:
+			m.handleList(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	case strings.HasSuffix(path, "/unban") && r.Method == http.MethodPost:
+		m.handleUnban(w, strings.TrimSuffix(strings.TrimPrefix(path, "/"), "/unban"))
+	case r.Method == http.MethodDelete:
+		m.handleDelete(w, strings.TrimPrefix(path, "/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+type createRequest struct {
+	URL          string   `json:"url"`
+	Secret       string   `json:"secret,omitempty"`
+	EventTypes   []string `json:"event_types,omitempty"`
+	Applications []string `json:"applications,omitempty"`
+}
+
+func (m *Manager) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var req createRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.URL == "" {
+		http.Error(w, "url is required", http.StatusBadRequest)
+		return
+	}
+
+	id, err := randomID()
+	if err != nil {
+		http.Error(w, "failed to generate subscription id", http.StatusInternalServerError)
+		return
+	}
+
+	sub := &Subscription{
+		ID:           id,
+		URL:          req.URL,
+		Secret:       req.Secret,
+		EventTypes:   req.EventTypes,
+		Applications: req.Applications,
+		CreatedAt:    time.Now(),
+	}
+
+	m.mu.Lock()
+	m.startWorker(sub)
+	subs := m.snapshotLocked()
+	m.mu.Unlock()
+
+	if err := m.store.Save(subs); err != nil {
+		log.Printf("subscriptions: failed to persist new subscription: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sub)
+}
+
+func (m *Manager) handleList(w http.ResponseWriter, r *http.Request) {
+	m.mu.RLock()
+	subs := m.snapshotLocked()
+	m.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subs)
+}
+
+func (m *Manager) handleDelete(w http.ResponseWriter, id string) {
+	m.mu.Lock()
+	wk, ok := m.workers[id]
+	if ok {
+		delete(m.workers, id)
+		close(wk.ch)
+	}
+	subs := m.snapshotLocked()
+	m.mu.Unlock()
+
+	if !ok {
+		http.Error(w, "subscription not found", http.StatusNotFound)
+		return
+	}
+
+	if err := m.store.Save(subs); err != nil {
+		log.Printf("subscriptions: failed to persist removal: %v", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *Manager) handleUnban(w http.ResponseWriter, id string) {
+	m.mu.Lock()
+	wk, ok := m.workers[id]
+	if ok {
+		wk.sub.Banned = false
+		wk.sub.Failures = 0
+	}
+	subs := m.snapshotLocked()
+	m.mu.Unlock()
+
+	if !ok {
+		http.Error(w, "subscription not found", http.StatusNotFound)
+		return
+	}
+
+	if err := m.store.Save(subs); err != nil {
+		log.Printf("subscriptions: failed to persist unban: %v", err)
+	}
+	w.WriteHeader(http.StatusOK)
+}
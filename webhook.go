@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"text/template"
+)
+
+// WebhookAuth carries HTTP Basic credentials for a WebhookDef.
+type WebhookAuth struct {
+	User string `json:"user"`
+	Pass string `json:"pass"`
+}
+
+// WebhookDef is a named, reusable webhook template. Applications opt into
+// one or more of these by name via ApplicationConfig.Webhooks, so the same
+// Twilio/Discord/internal hook can be shared across apps without repeating
+// the URL, auth, and body shape everywhere.
+type WebhookDef struct {
+	Name    string            `json:"name"`
+	URL     string            `json:"url"`
+	Auth    *WebhookAuth      `json:"auth,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Mode    string            `json:"mode"` // "json" or "form"; defaults to "json"
+	Body    string            `json:"body,omitempty"`
+	Form    map[string]string `json:"form,omitempty"`
+	Secret  string            `json:"secret,omitempty"`
+}
+
+// webhookContext is the template context every URL/header/body/form value
+// is rendered against.
+type webhookContext struct {
+	Application  string
+	URL          string
+	Event        string
+	StatusCode   int
+	ExpectedCode int
+	Timestamp    string
+	Error        string
+	Reason       string
+	Token        string
+}
+
+func newWebhookContext(event Event) webhookContext {
+	ctx := webhookContext{
+		Application:  event.Application,
+		URL:          event.URL,
+		Event:        event.Type,
+		StatusCode:   event.StatusCode,
+		ExpectedCode: event.ExpectedCode,
+		Timestamp:    event.Timestamp.Format("2006-01-02 15:04:05"),
+		Reason:       event.Reason,
+		Token:        event.Token,
+	}
+	if event.Err != nil {
+		ctx.Error = event.Err.Error()
+	}
+	return ctx
+}
+
+func renderTemplate(name, tmplStr string, ctx webhookContext) (string, error) {
+	t, err := template.New(name).Parse(tmplStr)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, ctx); err != nil {
+		return "", fmt.Errorf("failed to render template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+func findWebhookDef(defs []WebhookDef, name string) (WebhookDef, bool) {
+	for _, def := range defs {
+		if def.Name == name {
+			return def, true
+		}
+	}
+	return WebhookDef{}, false
+}
+
+func (m *Monitor) webhookByName(name string) (WebhookDef, bool) {
+	return findWebhookDef(m.config.Webhooks, name)
+}
+
+// sendWebhooks fires every named webhook hook for an event, logging
+// per-hook success or failure. Unknown names are logged and skipped rather
+// than failing the whole notification.
+func (m *Monitor) sendWebhooks(hooks []string, event Event) {
+	if len(hooks) == 0 {
+		return
+	}
+
+	ctx := newWebhookContext(event)
+	for _, name := range hooks {
+		def, ok := m.webhookByName(name)
+		if !ok {
+			log.Printf("Application %s references unknown webhook %q", event.Application, name)
+			continue
+		}
+
+		if err := m.sendWebhook(def, ctx); err != nil {
+			log.Printf("Webhook %q failed for %s: %v", def.Name, event.Application, err)
+		} else {
+			log.Printf("Webhook %q sent for %s (%s)", def.Name, event.Application, event.Type)
+		}
+	}
+}
+
+func (m *Monitor) sendWebhook(def WebhookDef, ctx webhookContext) error {
+	renderedURL, err := renderTemplate(def.Name+"-url", def.URL, ctx)
+	if err != nil {
+		return err
+	}
+
+	var rawBody []byte
+	var contentType string
+
+	if def.Mode == "form" {
+		values := url.Values{}
+		for field, tmpl := range def.Form {
+			rendered, err := renderTemplate(def.Name+"-form-"+field, tmpl, ctx)
+			if err != nil {
+				return err
+			}
+			values.Set(field, rendered)
+		}
+		rawBody = []byte(values.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	} else {
+		rendered, err := renderTemplate(def.Name+"-body", def.Body, ctx)
+		if err != nil {
+			return err
+		}
+		rawBody = []byte(rendered)
+		contentType = "application/json"
+	}
+
+	req, err := http.NewRequest("POST", renderedURL, bytes.NewReader(rawBody))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "AppMonitor/1.0")
+
+	for header, tmpl := range def.Headers {
+		rendered, err := renderTemplate(def.Name+"-header-"+header, tmpl, ctx)
+		if err != nil {
+			return err
+		}
+		req.Header.Set(header, rendered)
+	}
+
+	if def.Auth != nil {
+		req.SetBasicAuth(def.Auth.User, def.Auth.Pass)
+	}
+
+	if def.Secret != "" {
+		req.Header.Set("X-AppMonitor-Signature", generateWebhookSignature(rawBody, def.Secret))
+	}
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook request failed with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func generateWebhookSignature(payload []byte, secret string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(payload)
+	return "sha256=" + hex.EncodeToString(h.Sum(nil))
+}